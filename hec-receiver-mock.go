@@ -1,56 +1,399 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	defaultServerTimeout = 20 * time.Second
 
-	responseOK                        = "OK"
-	responseNotFound                  = "Not found"
-	responseInvalidMethod             = `Only "POST" method is supported`
-	responseInvalidEncoding           = `"Content-Encoding" must be "gzip" or empty`
-	responseErrGzipReader             = "Error on gzip body"
-	responseErrUnmarshalBody          = "Failed to unmarshal message body"
-	responseErrInternalServerError    = "Internal Server Error"
-	responseErrUnsupportedMetricEvent = "Unsupported metric event"
-	responseErrUnsupportedLogEvent    = "Unsupported log event"
+	// defaultMaxRequestBodyBytes is Config.MaxRequestBodyBytes' default: how
+	// much of a single request body to buffer/decompress, to keep a
+	// misbehaving client from exhausting memory.
+	defaultMaxRequestBodyBytes = 10 << 20 // 10 MiB
+
+	// maxRawLineBytes bounds a single line on the /services/collector/raw
+	// path, where one line is one event.
+	maxRawLineBytes = 1 << 20 // 1 MiB
+
+	// writeTimeoutMargin is how far ahead of Config.WriteTimeout we respond
+	// with a timeout error, so the client gets a clean JSON body instead of
+	// a connection reset when http.Server's own WriteTimeout fires.
+	writeTimeoutMargin = 500 * time.Millisecond
+
+	defaultHealthCheckPath = "/services/collector/health"
+
+	// HEC response codes, matching the Splunk HTTP Event Collector error catalog.
+	// See https://docs.splunk.com/Documentation/Splunk/latest/Data/TroubleshootHTTPEventCollector
+	hecCodeSuccess              = 0
+	hecCodeNoData               = 5
+	hecCodeInvalidDataFormat    = 6
+	hecCodeIncorrectIndex       = 7
+	hecCodeEventFieldRequired   = 12
+	hecCodeEventFieldBlank      = 13
+	hecCodeFieldsMustBeObject   = 14
+	hecCodeErrorHandlingIndexed = 15
+	hecCodeInvalidToken         = 4
+	hecCodeServerBusy           = 9
+
+	responseInvalidMethod   = `Only "POST" method is supported`
+	responseInvalidEncoding = `"Content-Encoding" must be "gzip" or empty`
+	responseErrGzipReader   = "Error on gzip body"
 
 	// Centralizing some HTTP and related string constants.
 	gzipEncoding              = "gzip"
 	httpContentEncodingHeader = "Content-Encoding"
+	httpSplunkChannelHeader   = "X-Splunk-Request-Channel"
 )
 
+// hecCodeText holds the canonical "text" message for each HEC response code.
+var hecCodeText = map[int]string{
+	hecCodeSuccess:              "Success",
+	hecCodeNoData:               "No data",
+	hecCodeInvalidDataFormat:    "Invalid data format",
+	hecCodeIncorrectIndex:       "Incorrect index",
+	hecCodeEventFieldRequired:   "Event field is required",
+	hecCodeEventFieldBlank:      "Event field cannot be blank",
+	hecCodeFieldsMustBeObject:   "Fields must be an object",
+	hecCodeErrorHandlingIndexed: "Error in handling indexed fields",
+	hecCodeInvalidToken:         "Invalid token",
+	hecCodeServerBusy:           "server is busy",
+}
+
 var (
 	errNilNextMetricsConsumer = errors.New("nil metricsConsumer")
 	errNilNextLogsConsumer    = errors.New("nil logsConsumer")
 	errEmptyEndpoint          = errors.New("empty endpoint")
 
-	okRespBody                = initJSONResponse(responseOK)
-	notFoundRespBody          = initJSONResponse(responseNotFound)
-	invalidMethodRespBody     = initJSONResponse(responseInvalidMethod)
-	invalidEncodingRespBody   = initJSONResponse(responseInvalidEncoding)
-	errGzipReaderRespBody     = initJSONResponse(responseErrGzipReader)
-	errUnmarshalBodyRespBody  = initJSONResponse(responseErrUnmarshalBody)
-	errInternalServerError    = initJSONResponse(responseErrInternalServerError)
-	errUnsupportedMetricEvent = initJSONResponse(responseErrUnsupportedMetricEvent)
-	errUnsupportedLogEvent    = initJSONResponse(responseErrUnsupportedLogEvent)
+	okRespBody              = newHECRespBody(hecCodeSuccess)
+	noDataRespBody          = newHECRespBody(hecCodeNoData)
+	invalidDataFormatBody   = newHECRespBody(hecCodeInvalidDataFormat)
+	invalidMethodRespBody   = initJSONResponse(responseInvalidMethod)
+	invalidEncodingRespBody = newHECRespBodyWithText(hecCodeInvalidDataFormat, responseInvalidEncoding)
+	errGzipReaderRespBody   = newHECRespBodyWithText(hecCodeInvalidDataFormat, responseErrGzipReader)
+	invalidTokenRespBody    = newHECRespBody(hecCodeInvalidToken)
+	requestTimeoutRespBody  = newHECRespBodyWithText(hecCodeServerBusy, "request timed out")
+	serverBusyRespBody      = newHECRespBody(hecCodeServerBusy)
 )
 
+// Prometheus metrics, scraped via /metrics.
+var (
+	promEventsReceivedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hecmock_events_received_total",
+		Help: "Total number of events received, by source.",
+	}, []string{"source"})
+
+	promBytesReceivedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hecmock_bytes_received_total",
+		Help: "Total number of event bytes received, by source.",
+	}, []string{"source"})
+
+	promEPS = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "hecmock_eps",
+		Help: "Events per second observed over the source's lifetime, by source.",
+	}, []string{"source"})
+
+	promRequestLatencySeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "hecmock_request_latency_seconds",
+		Help:    "Time spent handling a single HEC request.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	promBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "hecmock_batch_size",
+		Help:    "Number of events decoded from a single HEC request.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 16),
+	})
+)
+
+func init() {
+	prometheus.MustRegister(promEventsReceivedTotal, promBytesReceivedTotal, promEPS, promRequestLatencySeconds, promBatchSize)
+}
+
+// hecResponse is the structured body returned by every HEC endpoint, matching
+// the shape Splunk forwarders and HEC SDKs parse: {"text":..., "code":...}.
+type hecResponse struct {
+	Text               string `json:"text"`
+	Code               int    `json:"code"`
+	InvalidEventNumber *int   `json:"invalid-event-number,omitempty"`
+	AckID              *int64 `json:"ackId,omitempty"`
+}
+
+// newHECRespBody marshals the canonical response for a HEC response code.
+func newHECRespBody(code int) []byte {
+	b, err := json.Marshal(hecResponse{Text: hecCodeText[code], Code: code})
+	if err != nil {
+		// This is to be used in initialization so panic here is fine.
+		panic(err)
+	}
+	return b
+}
+
+// newHECRespBodyWithText marshals a response for code, overriding the
+// canonical catalog text with a more specific message.
+func newHECRespBodyWithText(code int, text string) []byte {
+	b, err := json.Marshal(hecResponse{Text: text, Code: code})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// newHECEventErrorRespBody marshals a per-event validation failure, including
+// the index of the first offending event as Splunk's HEC does.
+func newHECEventErrorRespBody(code int, eventNumber int) []byte {
+	b, err := json.Marshal(hecResponse{
+		Text:               hecCodeText[code],
+		Code:               code,
+		InvalidEventNumber: &eventNumber,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// LogsConsumer receives the batch of non-metric events decoded from a single
+// HEC request. Implementations can forward events on to OTLP, Kafka, stdout,
+// or anywhere else; the default implementation only records stats.
+// The slice passed in is built per call by consume; the per-request slice it
+// is split from is the one that is pooled (see eventSlicePool).
+type LogsConsumer interface {
+	ConsumeLogs(ctx context.Context, events []*Event) error
+}
+
+// MetricsConsumer receives the batch of events with Event=="metric" decoded
+// from a single HEC request, mirroring the logs/metrics split the upstream
+// splunkhecreceiver implements. The slice passed in is built per call, as
+// for LogsConsumer.
+type MetricsConsumer interface {
+	ConsumeMetrics(ctx context.Context, events []*Event) error
+}
+
+// TokenConfig describes one HEC token's authentication and ingestion policy:
+// what index/source/sourcetype to fill in when an event omits them, which
+// indexes it's allowed to write to, and how fast it's allowed to send.
+type TokenConfig struct {
+	Token             string   `json:"token"`
+	Disabled          bool     `json:"disabled"`
+	DefaultIndex      string   `json:"default_index"`
+	AllowedIndexes    []string `json:"allowed_indexes"`
+	DefaultSource     string   `json:"default_source"`
+	DefaultSourceType string   `json:"default_sourcetype"`
+	// RateLimitEPS caps accepted events per second per channel for this
+	// token; zero means unlimited.
+	RateLimitEPS float64 `json:"rate_limit_eps"`
+}
+
+// TokenStore resolves a presented HEC token to its TokenConfig. Implementations
+// report ok=false for unknown or disabled tokens so callers don't have to
+// check Disabled themselves.
+type TokenStore interface {
+	Lookup(token string) (TokenConfig, bool)
+}
+
+// staticTokenStore is a TokenStore backed by a fixed set of TokenConfigs
+// loaded once at startup, e.g. via LoadTokenStoreFile.
+type staticTokenStore struct {
+	tokens map[string]TokenConfig
+}
+
+// NewStaticTokenStore builds a TokenStore from a fixed list of TokenConfigs.
+func NewStaticTokenStore(tokens []TokenConfig) TokenStore {
+	byToken := make(map[string]TokenConfig, len(tokens))
+	for _, tc := range tokens {
+		byToken[tc.Token] = tc
+	}
+	return &staticTokenStore{tokens: byToken}
+}
+
+func (s *staticTokenStore) Lookup(token string) (TokenConfig, bool) {
+	tc, ok := s.tokens[token]
+	if !ok || tc.Disabled {
+		return TokenConfig{}, false
+	}
+	return tc, true
+}
+
+// LoadTokenStoreFile reads a JSON array of TokenConfig from path and returns
+// a TokenStore backed by it.
+func LoadTokenStoreFile(path string) (TokenStore, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading token store file %s: %w", path, err)
+	}
+	var tokens []TokenConfig
+	if err := json.Unmarshal(b, &tokens); err != nil {
+		return nil, fmt.Errorf("parsing token store file %s: %w", path, err)
+	}
+	return NewStaticTokenStore(tokens), nil
+}
+
+// Config controls how the mock HEC server listens and behaves.
+type Config struct {
+	// Endpoint is the host:port the server listens on, e.g. ":8088".
+	Endpoint string
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// MaxRequestBodyBytes bounds how much of a request body will be
+	// buffered/decompressed.
+	MaxRequestBodyBytes int64
+
+	// TLSCertFile and TLSKeyFile, if both set, make Start serve HTTPS.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// HealthCheckPath is served with a plain 200 OK, for use by load
+	// balancers and orchestrators.
+	HealthCheckPath string
+
+	// TokenStore, if non-nil, restricts /services/collector* to requests
+	// bearing a known, enabled HEC token via "Authorization: Splunk <token>",
+	// and supplies that token's per-event defaults, index allow-list, and
+	// rate limit.
+	TokenStore TokenStore
+}
+
+// DefaultConfig returns the endpoint and timeouts this package hard-coded
+// before Config existed (":8088", 20s ReadHeaderTimeout and WriteTimeout),
+// plus a 20s IdleTimeout, a 10 MiB MaxRequestBodyBytes and the default
+// health-check path.
+func DefaultConfig() Config {
+	return Config{
+		Endpoint:            ":8088",
+		ReadHeaderTimeout:   defaultServerTimeout,
+		WriteTimeout:        defaultServerTimeout,
+		IdleTimeout:         defaultServerTimeout,
+		MaxRequestBodyBytes: defaultMaxRequestBodyBytes,
+		HealthCheckPath:     defaultHealthCheckPath,
+	}
+}
+
+// withDefaults fills in zero-value fields that are safe to default, leaving
+// Endpoint alone since a missing bind address is a caller error.
+func (c Config) withDefaults() Config {
+	if c.ReadHeaderTimeout == 0 {
+		c.ReadHeaderTimeout = defaultServerTimeout
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = defaultServerTimeout
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = defaultServerTimeout
+	}
+	if c.MaxRequestBodyBytes == 0 {
+		c.MaxRequestBodyBytes = defaultMaxRequestBodyBytes
+	}
+	if c.HealthCheckPath == "" {
+		c.HealthCheckPath = defaultHealthCheckPath
+	}
+	return c
+}
+
 type splunkReceiver struct {
+	cfg             Config
 	server          *http.Server
-	performanceStat map[string]*eventSourceStat
+	performanceStat *sync.Map // source string -> *eventSourceStat
+	logsConsumer    LogsConsumer
+	metricsConsumer MetricsConsumer
+
+	ackMu     sync.Mutex
+	nextAckID int64
+	ackedIDs  map[int64]struct{}
+
+	tokenStats   sync.Map // token string -> *tokenStat
+	rateLimiters sync.Map // "token\x00channel" -> *tokenBucket
+}
+
+// Option configures a splunkReceiver constructed via NewLogsReceiver.
+type Option func(*splunkReceiver)
+
+// WithLogsConsumer overrides the default stats-only LogsConsumer.
+func WithLogsConsumer(c LogsConsumer) Option {
+	return func(r *splunkReceiver) {
+		r.logsConsumer = c
+	}
+}
+
+// WithMetricsConsumer overrides the default stats-only MetricsConsumer.
+func WithMetricsConsumer(c MetricsConsumer) Option {
+	return func(r *splunkReceiver) {
+		r.metricsConsumer = c
+	}
+}
+
+// statsConsumer is the default LogsConsumer/MetricsConsumer: it preserves the
+// mock's original behavior of only recording throughput stats surfaced via
+// /summary, without forwarding events anywhere. It is safe for concurrent
+// use: eventSourceStat's counters are atomic, and stats itself is a sync.Map
+// keyed by source so concurrent requests for different sources never
+// contend on a shared lock.
+type statsConsumer struct {
+	stats sync.Map // source string -> *eventSourceStat
+}
+
+func (c *statsConsumer) ConsumeLogs(ctx context.Context, events []*Event) error {
+	return c.recordStats(events)
+}
+
+func (c *statsConsumer) ConsumeMetrics(ctx context.Context, events []*Event) error {
+	return c.recordStats(events)
+}
+
+// recordStats samples time.Now() once per call rather than once per event,
+// since under real HEC batch sizes the latter dominates CPU for no benefit.
+func (c *statsConsumer) recordStats(events []*Event) error {
+	now := time.Now()
+	for _, event := range events {
+		val, _ := c.stats.LoadOrStore(event.Source, newEventSourceStat(now))
+		esStat := val.(*eventSourceStat)
+
+		eventsReceived := esStat.eventsReceived.Add(1)
+		esStat.bytesReceived.Add(int64(len(event.Event)))
+		esStat.mu.Lock()
+		beginTime := esStat.beginTime
+		esStat.endTime = now
+		esStat.mu.Unlock()
+
+		promEventsReceivedTotal.WithLabelValues(event.Source).Inc()
+		promBytesReceivedTotal.WithLabelValues(event.Source).Add(float64(len(event.Event)))
+		if duration := now.Sub(beginTime).Seconds(); duration > 0 {
+			promEPS.WithLabelValues(event.Source).Set(float64(eventsReceived) / duration)
+		}
+
+		if len(event.Event) >= 9 && event.Event[:9] == "---end---" {
+			generatedCount, err := strconv.ParseInt(event.Event[9:], 10, 64)
+			if err != nil {
+				return err
+			}
+			esStat.generatedCount.Store(generatedCount)
+		}
+	}
+	return nil
 }
 
 type summaryData struct {
@@ -63,45 +406,296 @@ type summaryData struct {
 	EndTime        time.Time `json:"endTime"`
 }
 
-func NewLogsReceiver() (*splunkReceiver, error) {
+func NewLogsReceiver(cfg Config, opts ...Option) (*splunkReceiver, error) {
+	if cfg.Endpoint == "" {
+		return nil, errEmptyEndpoint
+	}
+	cfg = cfg.withDefaults()
+
+	stats := &statsConsumer{}
 	r := &splunkReceiver{
-		performanceStat: map[string]*eventSourceStat{},
-		server: &http.Server{
-			Addr:              ":8088",
-			ReadHeaderTimeout: defaultServerTimeout,
-			WriteTimeout:      defaultServerTimeout,
-		},
+		cfg:             cfg,
+		performanceStat: &stats.stats,
+		ackedIDs:        map[int64]struct{}{},
+		logsConsumer:    stats,
+		metricsConsumer: stats,
+		server:          &http.Server{Addr: cfg.Endpoint},
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.logsConsumer == nil {
+		return nil, errNilNextLogsConsumer
+	}
+	if r.metricsConsumer == nil {
+		return nil, errNilNextMetricsConsumer
 	}
 
 	return r, nil
 }
 
-func (r *splunkReceiver) Start() error {
-	// set up the listener
-	ln, err := net.Listen("tcp", ":8088")
+// Start binds the listener, serves until ctx is canceled or the server
+// fails, and then shuts down gracefully.
+func (r *splunkReceiver) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", r.cfg.Endpoint)
 	if err != nil {
-		return fmt.Errorf("failed to bind to address %s: %w", ":8088", err)
+		return fmt.Errorf("failed to bind to address %s: %w", r.cfg.Endpoint, err)
 	}
 
 	mx := mux.NewRouter()
+	mx.HandleFunc(r.cfg.HealthCheckPath, r.health)
+	mx.Handle("/metrics", promhttp.Handler())
 	mx.HandleFunc("/summary", r.summary)
-	mx.NewRoute().HandlerFunc(r.handleReq)
+	mx.HandleFunc("/summary/tokens", r.summaryTokens)
+	mx.HandleFunc("/services/collector/ack", r.authenticate(r.handleAck))
+	mx.HandleFunc("/services/collector/raw", r.authenticate(r.handleRawReq))
+	mx.HandleFunc("/services/collector/event", r.authenticate(r.handleReq))
+	mx.HandleFunc("/services/collector", r.authenticate(r.handleReq))
+	mx.NewRoute().HandlerFunc(r.authenticate(r.handleReq))
+
+	r.server.Handler = r.wrapWriteTimeout(mx, r.cfg.WriteTimeout)
+	r.server.ReadTimeout = r.cfg.ReadTimeout
+	r.server.ReadHeaderTimeout = r.cfg.ReadHeaderTimeout
+	r.server.WriteTimeout = r.cfg.WriteTimeout
+	r.server.IdleTimeout = r.cfg.IdleTimeout
 
-	r.server = &http.Server{
-		Handler: mx,
+	serveErrCh := make(chan error, 1)
+	go func() {
+		var serveErr error
+		if r.cfg.TLSCertFile != "" && r.cfg.TLSKeyFile != "" {
+			serveErr = r.server.ServeTLS(ln, r.cfg.TLSCertFile, r.cfg.TLSKeyFile)
+		} else {
+			serveErr = r.server.Serve(ln)
+		}
+		if serveErr == http.ErrServerClosed {
+			serveErr = nil
+		}
+		serveErrCh <- serveErr
+	}()
+
+	select {
+	case <-ctx.Done():
+		return r.Shutdown(context.Background())
+	case serveErr := <-serveErrCh:
+		return serveErr
 	}
+}
 
-	// TODO: Evaluate what properties should be configurable, for now
-	//		set some hard-coded values.
-	r.server.ReadHeaderTimeout = defaultServerTimeout
-	r.server.WriteTimeout = defaultServerTimeout
+// Shutdown gracefully stops the server, letting in-flight requests finish.
+func (r *splunkReceiver) Shutdown(ctx context.Context) error {
+	return r.server.Shutdown(ctx)
+}
 
-	if errHTTP := r.server.Serve(ln); errHTTP != http.ErrServerClosed {
-		log.Println("error")
-		log.Fatalln(errHTTP.Error())
+func (r *splunkReceiver) health(resp http.ResponseWriter, req *http.Request) {
+	resp.WriteHeader(http.StatusOK)
+	resp.Write(okRespBody)
+}
+
+// tokenContextKey is the context key authenticate stores the request's
+// resolved TokenConfig under, for handleReq to apply per-token defaults,
+// the index allow-list, and rate limiting.
+type tokenContextKey struct{}
+
+// authenticate wraps next with HEC token validation. When no TokenStore is
+// configured, every request is allowed, matching the mock's original
+// behavior.
+func (r *splunkReceiver) authenticate(next http.HandlerFunc) http.HandlerFunc {
+	if r.cfg.TokenStore == nil {
+		return next
+	}
+	return func(resp http.ResponseWriter, req *http.Request) {
+		token := strings.TrimPrefix(req.Header.Get("Authorization"), "Splunk ")
+		tc, ok := r.cfg.TokenStore.Lookup(token)
+		if !ok {
+			r.failRequest(resp, http.StatusUnauthorized, invalidTokenRespBody)
+			return
+		}
+		next(resp, req.WithContext(context.WithValue(req.Context(), tokenContextKey{}, tc)))
+	}
+}
+
+// tokenBucket is a simple token-bucket rate limiter: tokens refill
+// continuously at rate per second, up to a burst capacity equal to rate.
+type tokenBucket struct {
+	mu         sync.Mutex
+	rate       float64
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, lastRefill: now}
+}
+
+// allow reports whether n events are within the bucket's current budget,
+// consuming them if so.
+func (b *tokenBucket) allow(n float64, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += now.Sub(b.lastRefill).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
 	}
+	b.lastRefill = now
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
 
-	return err
+// allowToken enforces tc.RateLimitEPS for this (token, channel) pair: each
+// HEC channel gets its own bucket so one noisy channel on a token can't
+// starve another sharing the same token.
+func (r *splunkReceiver) allowToken(tc TokenConfig, channel string, eventCount int) bool {
+	now := time.Now()
+	val, _ := r.rateLimiters.LoadOrStore(tc.Token+"\x00"+channel, newTokenBucket(tc.RateLimitEPS, now))
+	return val.(*tokenBucket).allow(float64(eventCount), now)
+}
+
+// enforceTokenPolicy applies req's resolved TokenConfig (if authenticate
+// attached one) to events: per-token defaults, the index allow-list, and
+// per-channel rate limiting. A returned ok of false means resp has already
+// been written to and the caller should return without writing anything
+// else.
+func (r *splunkReceiver) enforceTokenPolicy(req *http.Request, resp http.ResponseWriter, events []*Event, channel string) bool {
+	tc, ok := req.Context().Value(tokenContextKey{}).(TokenConfig)
+	if !ok {
+		return true
+	}
+	if badEventNumber, ok := applyTokenDefaults(events, tc); !ok {
+		r.failRequest(resp, http.StatusBadRequest, newHECEventErrorRespBody(hecCodeIncorrectIndex, badEventNumber))
+		return false
+	}
+	if tc.RateLimitEPS > 0 && !r.allowToken(tc, channel, len(events)) {
+		r.failRequest(resp, http.StatusTooManyRequests, serverBusyRespBody)
+		return false
+	}
+	r.recordTokenStat(tc.Token, len(events))
+	return true
+}
+
+// applyTokenDefaults fills in source/sourcetype/index on events that
+// didn't set them from tc, then - if tc restricts indexes - rejects the
+// first event whose (possibly just-defaulted) index isn't in that
+// allow-list, returning its index.
+func applyTokenDefaults(events []*Event, tc TokenConfig) (badEventNumber int, ok bool) {
+	var allowedIndexes map[string]struct{}
+	if len(tc.AllowedIndexes) > 0 {
+		allowedIndexes = make(map[string]struct{}, len(tc.AllowedIndexes))
+		for _, idx := range tc.AllowedIndexes {
+			allowedIndexes[idx] = struct{}{}
+		}
+	}
+	for i, event := range events {
+		if event.Index == "" {
+			event.Index = tc.DefaultIndex
+		}
+		if event.Source == "" {
+			event.Source = tc.DefaultSource
+		}
+		if event.SourceType == "" {
+			event.SourceType = tc.DefaultSourceType
+		}
+		if allowedIndexes != nil {
+			if _, ok := allowedIndexes[event.Index]; !ok {
+				return i, false
+			}
+		}
+	}
+	return 0, true
+}
+
+// onceResponseWriter lets at most one of {the wrapped handler, the
+// write-timeout responder} actually write to the underlying
+// http.ResponseWriter, whichever claims it first.
+type onceResponseWriter struct {
+	http.ResponseWriter
+	claimed *int32
+	owner   bool
+}
+
+func (w *onceResponseWriter) claim() bool {
+	if w.owner {
+		return true
+	}
+	if atomic.CompareAndSwapInt32(w.claimed, 0, 1) {
+		w.owner = true
+		return true
+	}
+	return false
+}
+
+func (w *onceResponseWriter) WriteHeader(code int) {
+	if w.claim() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *onceResponseWriter) Write(b []byte) (int, error) {
+	if w.claim() {
+		return w.ResponseWriter.Write(b)
+	}
+	return len(b), nil
+}
+
+// Flush implements http.Flusher by delegating to the wrapped
+// ResponseWriter, so handlers like summaryStream that type-assert for it
+// still work once wrapWriteTimeout has wrapped them in a onceResponseWriter:
+// embedding http.ResponseWriter only promotes its own method set, not the
+// concrete writer's Flush.
+func (w *onceResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// wrapWriteTimeout guards against http.Server's WriteTimeout silently
+// truncating the connection: ~writeTimeoutMargin before it would fire, if h
+// has not written anything yet, it gets a fixed-Content-Length, non-chunked,
+// uncompressed timeout response instead, and h's context is canceled. This
+// mirrors the request-timeout responder pattern used by go-ethereum's
+// JSON-RPC HTTP server.
+func (r *splunkReceiver) wrapWriteTimeout(h http.Handler, writeTimeout time.Duration) http.Handler {
+	if writeTimeout <= writeTimeoutMargin {
+		return h
+	}
+	timeout := writeTimeout - writeTimeoutMargin
+
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+
+		claimed := new(int32)
+		tw := &onceResponseWriter{ResponseWriter: resp, claimed: claimed}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			h.ServeHTTP(tw, req.WithContext(ctx))
+		}()
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-done:
+		case <-timer.C:
+			if atomic.CompareAndSwapInt32(claimed, 0, 1) {
+				// No gzip, no chunked transfer encoding: the client needs a
+				// complete, self-describing response before the real
+				// WriteTimeout deadline lands on top of it.
+				resp.Header().Del(httpContentEncodingHeader)
+				resp.Header().Set("Content-Type", "application/json")
+				resp.Header().Set("Content-Length", strconv.Itoa(len(requestTimeoutRespBody)))
+				resp.WriteHeader(http.StatusServiceUnavailable)
+				resp.Write(requestTimeoutRespBody)
+			}
+			cancel()
+			<-done
+		}
+	})
 }
 
 type Event struct {
@@ -114,81 +708,355 @@ type Event struct {
 	Fields     map[string]interface{} `json:"fields,omitempty"`     // dimensions and metric data
 }
 
-// UnmarshalJSON unmarshals the JSON representation of an event
+// hecEventValidationError is returned from Event.UnmarshalJSON for the
+// specific per-event problems Splunk's HEC assigns their own response code,
+// so decodeAndValidateEvents can report that code instead of a generic
+// "invalid data format" after a single decode pass.
+type hecEventValidationError struct {
+	code int
+}
+
+func (e *hecEventValidationError) Error() string {
+	return hecCodeText[e.code]
+}
+
+// eventWire mirrors Event's JSON shape but keeps "time", "event" and
+// "fields" as raw JSON so UnmarshalJSON can tell a missing key apart from an
+// empty/null one, and can parse "time" without boxing it through
+// interface{}.
+type eventWire struct {
+	Time       json.RawMessage `json:"time"`
+	Host       string          `json:"host"`
+	Source     string          `json:"source"`
+	SourceType string          `json:"sourcetype"`
+	Index      string          `json:"index"`
+	Event      json.RawMessage `json:"event"`
+	Fields     json.RawMessage `json:"fields"`
+}
+
+// UnmarshalJSON unmarshals the JSON representation of an event in a single
+// pass, classifying the per-event problems Splunk's HEC has dedicated
+// response codes for as a *hecEventValidationError.
+//
+// This intentionally stays on encoding/json rather than reaching for
+// jsoniter/go-json or a generated easyjson/ffjson decoder: those add a
+// dependency this mock otherwise has none of, for a gain that the single-pass
+// eventWire restructuring (no more round-tripping "time" through
+// interface{}) already captures most of - see
+// BenchmarkEventUnmarshalJSON_SinglePass vs.
+// BenchmarkEventUnmarshalJSON_NaiveDoubleUnmarshal in
+// hec-receiver-mock_bench_test.go for the before/after.
 func (e *Event) UnmarshalJSON(b []byte) error {
-	rawEvent := struct {
-		Time       interface{}            `json:"time,omitempty"`
-		Host       string                 `json:"host"`
-		Source     string                 `json:"source,omitempty"`
-		SourceType string                 `json:"sourcetype,omitempty"`
-		Index      string                 `json:"index,omitempty"`
-		Event      string                 `json:"event"`
-		Fields     map[string]interface{} `json:"fields,omitempty"`
-	}{}
-	err := json.Unmarshal(b, &rawEvent)
+	var wire eventWire
+	if err := json.Unmarshal(b, &wire); err != nil {
+		return err
+	}
+
+	if wire.Event == nil {
+		return &hecEventValidationError{code: hecCodeEventFieldRequired}
+	}
+	var eventStr string
+	if err := json.Unmarshal(wire.Event, &eventStr); err != nil {
+		return &hecEventValidationError{code: hecCodeInvalidDataFormat}
+	}
+	// An explicit "event": null unmarshals to "" same as "event": "" would,
+	// but Splunk only rejects the latter - null is silently accepted as an
+	// empty event, so it's excluded here by checking the raw bytes.
+	if eventStr == "" && string(bytes.TrimSpace(wire.Event)) != "null" {
+		return &hecEventValidationError{code: hecCodeEventFieldBlank}
+	}
+
+	var fields map[string]interface{}
+	if len(wire.Fields) > 0 {
+		if string(bytes.TrimSpace(wire.Fields)) == "null" {
+			return &hecEventValidationError{code: hecCodeFieldsMustBeObject}
+		}
+		if err := json.Unmarshal(wire.Fields, &fields); err != nil {
+			return &hecEventValidationError{code: hecCodeFieldsMustBeObject}
+		}
+		if err := validateIndexedFields(fields); err != nil {
+			return err
+		}
+	}
+
+	eventTime, err := parseEventTime(wire.Time)
 	if err != nil {
 		return err
 	}
-	*e = Event{
-		Host:       rawEvent.Host,
-		Source:     rawEvent.Source,
-		SourceType: rawEvent.SourceType,
-		Index:      rawEvent.Index,
-		Event:      rawEvent.Event,
-		Fields:     rawEvent.Fields,
-	}
-	switch t := rawEvent.Time.(type) {
-	case float64:
-		e.Time = &t
-	case string:
-		{
-			time, err := strconv.ParseFloat(t, 64)
-			if err != nil {
-				return err
-			}
-			e.Time = &time
+
+	e.Time = eventTime
+	e.Host = wire.Host
+	e.Source = wire.Source
+	e.SourceType = wire.SourceType
+	e.Index = wire.Index
+	e.Event = eventStr
+	e.Fields = fields
+	return nil
+}
+
+// validateIndexedFields reports hecCodeErrorHandlingIndexed for an indexed
+// field value Splunk can't index: a nested object, or an array containing
+// one. This is distinct from hecCodeFieldsMustBeObject, which only covers
+// "fields" itself not being a JSON object - here "fields" parsed fine, but
+// one of its values didn't. Scalars and arrays of scalars are left alone.
+func validateIndexedFields(fields map[string]interface{}) error {
+	for _, v := range fields {
+		if !isIndexableFieldValue(v) {
+			return &hecEventValidationError{code: hecCodeErrorHandlingIndexed}
 		}
 	}
 	return nil
 }
 
+func isIndexableFieldValue(v interface{}) bool {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return false
+	case []interface{}:
+		for _, elem := range val {
+			if _, nested := elem.(map[string]interface{}); nested {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseEventTime parses HEC's dual-typed "time" field - epoch seconds as
+// either a JSON number or a numeric string - by branching on the first
+// non-whitespace byte instead of round-tripping the value through
+// interface{}.
+func parseEventTime(raw json.RawMessage) (*float64, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 || string(trimmed) == "null" {
+		return nil, nil
+	}
+	if trimmed[0] == '"' {
+		var s string
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return nil, err
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &f, nil
+	}
+	var f float64
+	if err := json.Unmarshal(trimmed, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// eventSlicePool recycles the []*Event batches decoded per request. Pooling
+// the decoder itself isn't possible: encoding/json.Decoder has no Reset and
+// is tied to the io.Reader it was created with. The pooled slice itself is
+// never handed to a LogsConsumer/MetricsConsumer: consume splits its events
+// into new slices for them.
+var eventSlicePool = sync.Pool{
+	New: func() interface{} {
+		s := make([]*Event, 0, 64)
+		return &s
+	},
+}
+
+func acquireEventSlice() *[]*Event {
+	return eventSlicePool.Get().(*[]*Event)
+}
+
+func releaseEventSlice(events *[]*Event) {
+	*events = (*events)[:0]
+	eventSlicePool.Put(events)
+}
+
+// decodeAndValidateEvents streams events off of dec, validating each one the
+// way Splunk's HEC does, and returns the decoded events. On the first invalid
+// event it writes that event's index and response code to resp instead. A
+// returned ok of false means resp has already been written to and the caller
+// should return without writing anything else.
+func (r *splunkReceiver) decodeAndValidateEvents(dec *json.Decoder, resp http.ResponseWriter, eventsPtr *[]*Event) ([]*Event, bool) {
+	eventNumber := 0
+	for dec.More() {
+		msg := new(Event)
+		if err := dec.Decode(msg); err != nil {
+			var valErr *hecEventValidationError
+			if errors.As(err, &valErr) {
+				r.failRequest(resp, http.StatusBadRequest, newHECEventErrorRespBody(valErr.code, eventNumber))
+			} else {
+				r.failRequest(resp, http.StatusBadRequest, invalidDataFormatBody)
+			}
+			return nil, false
+		}
+		*eventsPtr = append(*eventsPtr, msg)
+		eventNumber++
+	}
+	return *eventsPtr, true
+}
+
+// decodeBody applies the configured request body size limit and, if
+// Content-Encoding: gzip was set, wraps body in a real gzip.Reader. The
+// caller is responsible for closing the returned reader.
+func (r *splunkReceiver) decodeBody(resp http.ResponseWriter, req *http.Request) (io.ReadCloser, bool) {
+	limited := http.MaxBytesReader(resp, req.Body, r.cfg.MaxRequestBodyBytes)
+	switch req.Header.Get(httpContentEncodingHeader) {
+	case "":
+		return limited, true
+	case gzipEncoding:
+		gz, err := gzip.NewReader(limited)
+		if err != nil {
+			r.failRequest(resp, http.StatusBadRequest, errGzipReaderRespBody)
+			return nil, false
+		}
+		// MaxRequestBodyBytes only bounded the compressed bytes read off the
+		// wire; without also bounding gz's decompressed output, a small gzip
+		// payload could expand far past the configured cap (a decompression
+		// bomb) before anything reads a Content-Length.
+		return limitedReadCloser{
+			Reader: io.LimitReader(gz, r.cfg.MaxRequestBodyBytes),
+			Closer: gz,
+		}, true
+	default:
+		r.failRequest(resp, http.StatusBadRequest, invalidEncodingRespBody)
+		return nil, false
+	}
+}
+
+// limitedReadCloser pairs a size-limited Reader with the Closer of the
+// underlying stream it wraps, since io.LimitReader itself only implements
+// io.Reader.
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
 func (r *splunkReceiver) handleReq(resp http.ResponseWriter, req *http.Request) {
 	if req.ContentLength == 0 {
-		resp.Write(okRespBody)
+		r.failRequest(resp, http.StatusBadRequest, noDataRespBody)
 		return
 	}
-	dec := json.NewDecoder(req.Body)
-	var events []*Event
-	for dec.More() {
-		var msg Event
-		err := dec.Decode(&msg)
-		if err != nil {
-			r.failRequest(resp, http.StatusBadRequest, errUnmarshalBodyRespBody)
-			return
+	body, ok := r.decodeBody(resp, req)
+	if !ok {
+		return
+	}
+	defer body.Close()
+
+	eventsPtr := acquireEventSlice()
+	defer releaseEventSlice(eventsPtr)
+
+	dec := json.NewDecoder(body)
+	events, ok := r.decodeAndValidateEvents(dec, resp, eventsPtr)
+	if !ok {
+		return
+	}
+
+	channel := req.Header.Get(httpSplunkChannelHeader)
+	if !r.enforceTokenPolicy(req, resp, events, channel) {
+		return
+	}
+
+	r.consume(req.Context(), events, resp, channel)
+}
+
+// handleRawReq implements /services/collector/raw: the body is opaque, each
+// line becomes one event, and host/source/sourcetype/index are taken from
+// query parameters rather than per-event JSON fields.
+func (r *splunkReceiver) handleRawReq(resp http.ResponseWriter, req *http.Request) {
+	if req.ContentLength == 0 {
+		r.failRequest(resp, http.StatusBadRequest, noDataRespBody)
+		return
+	}
+	body, ok := r.decodeBody(resp, req)
+	if !ok {
+		return
+	}
+	defer body.Close()
+
+	q := req.URL.Query()
+	host := q.Get("host")
+	source := q.Get("source")
+	sourceType := q.Get("sourcetype")
+	index := q.Get("index")
+
+	eventsPtr := acquireEventSlice()
+	defer releaseEventSlice(eventsPtr)
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRawLineBytes)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
 		}
-		events = append(events, &msg)
+		*eventsPtr = append(*eventsPtr, &Event{
+			Host:       host,
+			Source:     source,
+			SourceType: sourceType,
+			Index:      index,
+			Event:      line,
+		})
 	}
-	r.consumeLogs(req.Context(), events, resp, req)
+	if err := scanner.Err(); err != nil {
+		r.failRequest(resp, http.StatusBadRequest, invalidDataFormatBody)
+		return
+	}
+
+	channel := req.Header.Get(httpSplunkChannelHeader)
+	if channel == "" {
+		channel = q.Get("channel")
+	}
+
+	events := *eventsPtr
+	if !r.enforceTokenPolicy(req, resp, events, channel) {
+		return
+	}
+
+	r.consume(req.Context(), events, resp, channel)
 }
 
 func (r *splunkReceiver) calculateStats() *[]summaryData {
 	var result []summaryData
-	for source, stats := range r.performanceStat {
-		sum := summaryData{
-			Source:         source,
-			Eps:            float64(stats.eventsReceived) / stats.endTime.Sub(stats.beginTime).Seconds(),
-			Thorughput:     stats.bytesReceived / 1024 / 1024,
-			DataIngestRate: float64(stats.eventsReceived) / float64(stats.generatedCount),
-			EventsReceived: stats.eventsReceived,
-			BeginTime:      stats.beginTime,
-			EndTime:        stats.endTime,
+	r.performanceStat.Range(func(key, value interface{}) bool {
+		source := key.(string)
+		stats := value.(*eventSourceStat)
+
+		stats.mu.Lock()
+		beginTime, endTime := stats.beginTime, stats.endTime
+		stats.mu.Unlock()
+
+		eventsReceived := stats.eventsReceived.Load()
+		generatedCount := stats.generatedCount.Load()
+
+		var dataIngestRate float64
+		if generatedCount != 0 {
+			dataIngestRate = float64(eventsReceived) / float64(generatedCount)
 		}
-		result = append(result, sum)
-	}
+
+		var eps float64
+		if duration := endTime.Sub(beginTime).Seconds(); duration > 0 {
+			eps = float64(eventsReceived) / duration
+		}
+
+		result = append(result, summaryData{
+			Source:         source,
+			Eps:            eps,
+			Thorughput:     float64(stats.bytesReceived.Load()) / 1024 / 1024,
+			DataIngestRate: dataIngestRate,
+			EventsReceived: eventsReceived,
+			BeginTime:      beginTime,
+			EndTime:        endTime,
+		})
+		return true
+	})
 	return &result
 }
 
 func (r *splunkReceiver) summary(resp http.ResponseWriter, req *http.Request) {
+	if req.URL.Query().Get("stream") == "1" {
+		r.summaryStream(resp, req)
+		return
+	}
+
 	resp.Header().Set("Content-Type", "application/json")
 	result := r.calculateStats()
 	js, err := json.Marshal(result)
@@ -204,39 +1072,247 @@ func (r *splunkReceiver) summary(resp http.ResponseWriter, req *http.Request) {
 	}
 }
 
-type eventSourceStat struct {
-	eventsReceived int64
-	beginTime      time.Time
-	bytesReceived  float64
-	endTime        time.Time
-	generatedCount int64
+// summaryTokens implements GET /summary/tokens: the same bare-array shape as
+// /summary and /summary?stream=1, broken down by HEC token instead of
+// source, for operators to see which producer is driving load.
+func (r *splunkReceiver) summaryTokens(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "application/json")
+	js, err := json.Marshal(r.calculateTokenStats())
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.WriteHeader(http.StatusAccepted)
+
+	_, writeErr := resp.Write(js)
+	if writeErr != nil {
+		log.Println("Error writing HTTP response message", zap.Error(writeErr))
+	}
 }
 
-func (r *splunkReceiver) consumeLogs(ctx context.Context, events []*Event, resp http.ResponseWriter, req *http.Request) {
-	for _, event := range events {
-		if _, ok := r.performanceStat[event.Source]; !ok {
-			r.performanceStat[event.Source] = &eventSourceStat{
-				eventsReceived: 0,
-				beginTime:      time.Now(),
-				bytesReceived:  0,
-				endTime:        time.Now(),
-				generatedCount: 1,
+// summaryStream implements GET /summary?stream=1: a server-sent-events feed
+// that pushes the incremental per-source delta since the last tick, once a
+// second, so load-test drivers can watch throughput live instead of polling.
+func (r *splunkReceiver) summaryStream(resp http.ResponseWriter, req *http.Request) {
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		http.Error(resp, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	resp.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	prev := map[string]summaryData{}
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			curr := *r.calculateStats()
+			deltas := summaryDeltas(prev, curr)
+			prev = summaryBySource(curr)
+			if len(deltas) == 0 {
+				continue
 			}
-		}
-		esStat := r.performanceStat[event.Source]
-		esStat.eventsReceived += 1
-		esStat.bytesReceived += float64(len(event.Event))
-		esStat.endTime = time.Now()
-		if event.Event[:9] == "---end---" {
-			generatedCount, err := strconv.ParseInt(event.Event[10:], 10, 64)
+			js, err := json.Marshal(deltas)
 			if err != nil {
-				log.Fatalln(err)
+				log.Println("Error marshaling summary stream message", zap.Error(err))
+				return
+			}
+			if _, err := fmt.Fprintf(resp, "data: %s\n\n", js); err != nil {
+				return
 			}
-			esStat.generatedCount = generatedCount
+			flusher.Flush()
+		}
+	}
+}
+
+// summaryBySource indexes a summary snapshot by source for diffing against
+// the next tick.
+func summaryBySource(data []summaryData) map[string]summaryData {
+	bySource := make(map[string]summaryData, len(data))
+	for _, d := range data {
+		bySource[d.Source] = d
+	}
+	return bySource
+}
+
+// summaryDeltas returns, for each source with new events since prev, a
+// summaryData whose EventsReceived/Thorughput are the delta rather than the
+// running total.
+func summaryDeltas(prev map[string]summaryData, curr []summaryData) []summaryData {
+	var deltas []summaryData
+	for _, c := range curr {
+		delta := c
+		if p, ok := prev[c.Source]; ok {
+			delta.EventsReceived = c.EventsReceived - p.EventsReceived
+			delta.Thorughput = c.Thorughput - p.Thorughput
+		}
+		if delta.EventsReceived > 0 {
+			deltas = append(deltas, delta)
+		}
+	}
+	return deltas
+}
+
+// ackRequest is the body HEC clients POST to /services/collector/ack to poll
+// for indexer acknowledgement of previously-submitted channelled requests.
+type ackRequest struct {
+	Acks []int64 `json:"acks"`
+}
+
+// ackStatusResponse reports, per requested ack ID, whether it has been acked.
+type ackStatusResponse struct {
+	Acks map[string]bool `json:"acks"`
+}
+
+// handleAck answers indexer-acknowledgement polling requests. Since this is a
+// mock, every ackId ever issued by handleReq is considered acked immediately.
+func (r *splunkReceiver) handleAck(resp http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		r.failRequest(resp, http.StatusBadRequest, invalidMethodRespBody)
+		return
+	}
+
+	var ackReq ackRequest
+	if err := json.NewDecoder(req.Body).Decode(&ackReq); err != nil {
+		r.failRequest(resp, http.StatusBadRequest, invalidDataFormatBody)
+		return
+	}
+
+	status := ackStatusResponse{Acks: make(map[string]bool, len(ackReq.Acks))}
+	r.ackMu.Lock()
+	for _, id := range ackReq.Acks {
+		_, acked := r.ackedIDs[id]
+		status.Acks[strconv.FormatInt(id, 10)] = acked
+	}
+	r.ackMu.Unlock()
+
+	js, err := json.Marshal(status)
+	if err != nil {
+		http.Error(resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(http.StatusOK)
+	if _, writeErr := resp.Write(js); writeErr != nil {
+		log.Println("Error writing HTTP response message", zap.Error(writeErr))
+	}
+}
+
+// issueAckID allocates and immediately marks-acked a new ack ID for a
+// channelled request, returning it for inclusion in the response body.
+func (r *splunkReceiver) issueAckID() int64 {
+	r.ackMu.Lock()
+	defer r.ackMu.Unlock()
+	id := r.nextAckID
+	r.nextAckID++
+	r.ackedIDs[id] = struct{}{}
+	return id
+}
+
+// eventSourceStat tracks throughput for a single event source. The counters
+// are atomic so concurrent requests carrying the same source don't race;
+// beginTime/endTime are guarded by mu since there's no atomic time.Time.
+type eventSourceStat struct {
+	eventsReceived atomic.Int64
+	bytesReceived  atomic.Int64
+	generatedCount atomic.Int64
+
+	mu        sync.Mutex
+	beginTime time.Time
+	endTime   time.Time
+}
+
+func newEventSourceStat(now time.Time) *eventSourceStat {
+	s := &eventSourceStat{beginTime: now, endTime: now}
+	s.generatedCount.Store(1)
+	return s
+}
+
+// tokenStat counts events a single HEC token has been allowed to push
+// through, for the per-token breakdown exposed via /summary/tokens.
+type tokenStat struct {
+	eventsAccepted atomic.Int64
+}
+
+// recordTokenStat credits token with n accepted events.
+func (r *splunkReceiver) recordTokenStat(token string, n int) {
+	val, _ := r.tokenStats.LoadOrStore(token, &tokenStat{})
+	val.(*tokenStat).eventsAccepted.Add(int64(n))
+}
+
+// tokenSummaryData is one token's row in the /summary/tokens breakdown.
+type tokenSummaryData struct {
+	Token          string `json:"token"`
+	EventsAccepted int64  `json:"eventsAccepted"`
+}
+
+func (r *splunkReceiver) calculateTokenStats() []tokenSummaryData {
+	var result []tokenSummaryData
+	r.tokenStats.Range(func(key, value interface{}) bool {
+		result = append(result, tokenSummaryData{
+			Token:          key.(string),
+			EventsAccepted: value.(*tokenStat).eventsAccepted.Load(),
+		})
+		return true
+	})
+	return result
+}
+
+// consume routes events to the logs or metrics consumer based on whether
+// Event=="metric", matching the split the upstream splunkhecreceiver
+// implements, then writes the HEC success response (including an ackId if
+// channel is non-empty).
+func (r *splunkReceiver) consume(ctx context.Context, events []*Event, resp http.ResponseWriter, channel string) {
+	start := time.Now()
+	defer func() {
+		promRequestLatencySeconds.Observe(time.Since(start).Seconds())
+	}()
+	promBatchSize.Observe(float64(len(events)))
+
+	var logEvents, metricEvents []*Event
+	for _, event := range events {
+		if event.Event == "metric" {
+			metricEvents = append(metricEvents, event)
+			continue
+		}
+		logEvents = append(logEvents, event)
+	}
+
+	if len(logEvents) > 0 {
+		if err := r.logsConsumer.ConsumeLogs(ctx, logEvents); err != nil {
+			log.Println("Error consuming logs", zap.Error(err))
+			r.failRequest(resp, http.StatusInternalServerError, invalidDataFormatBody)
+			return
+		}
+	}
+	if len(metricEvents) > 0 {
+		if err := r.metricsConsumer.ConsumeMetrics(ctx, metricEvents); err != nil {
+			log.Println("Error consuming metrics", zap.Error(err))
+			r.failRequest(resp, http.StatusInternalServerError, invalidDataFormatBody)
+			return
 		}
 	}
 
 	resp.WriteHeader(http.StatusAccepted)
+	if channel != "" {
+		ackID := r.issueAckID()
+		js, err := json.Marshal(hecResponse{Text: hecCodeText[hecCodeSuccess], Code: hecCodeSuccess, AckID: &ackID})
+		if err != nil {
+			log.Println("Error marshaling HTTP response message", zap.Error(err))
+			resp.Write(okRespBody)
+			return
+		}
+		resp.Write(js)
+		return
+	}
 	resp.Write(okRespBody)
 }
 
@@ -265,7 +1341,12 @@ func initJSONResponse(s string) []byte {
 }
 
 func main() {
-	r, _ := NewLogsReceiver()
+	r, err := NewLogsReceiver(DefaultConfig())
+	if err != nil {
+		log.Fatalln(err)
+	}
 	log.Println("start")
-	r.Start()
+	if err := r.Start(context.Background()); err != nil {
+		log.Fatalln(err)
+	}
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// gzipEventBatch encodes n newline-delimited HEC events and gzips the
+// result, matching what a real forwarder sends with Content-Encoding: gzip.
+func gzipEventBatch(b *testing.B, n int) []byte {
+	b.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(gz, `{"time":"%d.000","host":"bench-host","source":"bench","sourcetype":"bench","event":"event number %d"}`+"\n", i, i)
+	}
+	if err := gz.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// legacyEvent mirrors Event's pre-chunk0-5 decode shape: a plain struct
+// decoded by encoding/json reflection, then a second json.Unmarshal into a
+// shadow struct just to coerce "time" between its float64 and string wire
+// forms. It exists only as a benchmark baseline for
+// BenchmarkEventUnmarshalJSON_SinglePass below, not as production code.
+type legacyEvent struct {
+	Time       interface{}            `json:"time,omitempty"`
+	Host       string                 `json:"host"`
+	Source     string                 `json:"source,omitempty"`
+	SourceType string                 `json:"sourcetype,omitempty"`
+	Index      string                 `json:"index,omitempty"`
+	Event      string                 `json:"event"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+}
+
+func (e *legacyEvent) UnmarshalJSON(b []byte) error {
+	type shadow legacyEvent
+	var s shadow
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if str, ok := s.Time.(string); ok {
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return err
+		}
+		s.Time = f
+	}
+	*e = legacyEvent(s)
+	return nil
+}
+
+// BenchmarkEventUnmarshalJSON_NaiveDoubleUnmarshal is the "before" baseline
+// for BenchmarkEventUnmarshalJSON_SinglePass: legacyEvent's UnmarshalJSON
+// runs a nested json.Unmarshal into a shadow struct and decodes "time"
+// through interface{}, same as Event did before chunk0-5.
+func BenchmarkEventUnmarshalJSON_NaiveDoubleUnmarshal(b *testing.B) {
+	body := []byte(`{"time":"1000.000","host":"bench-host","source":"bench","sourcetype":"bench","event":"event number 0","fields":{"a":1}}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var e legacyEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkEventUnmarshalJSON_SinglePass is the "after": Event.UnmarshalJSON
+// decodes the same payload through eventWire in one reflective pass.
+func BenchmarkEventUnmarshalJSON_SinglePass(b *testing.B) {
+	body := []byte(`{"time":"1000.000","host":"bench-host","source":"bench","sourcetype":"bench","event":"event number 0","fields":{"a":1}}`)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkHandleReq_1kEvents_Gzip exercises the full gzip-decode +
+// per-event-validate + consume hot path handleReq drives on a real HEC
+// request.
+func BenchmarkHandleReq_1kEvents_Gzip(b *testing.B) {
+	r, err := NewLogsReceiver(DefaultConfig())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	body := gzipEventBatch(b, 1000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("POST", "/services/collector/event", bytes.NewReader(body))
+		req.Header.Set(httpContentEncodingHeader, gzipEncoding)
+		req = req.WithContext(context.Background())
+		resp := httptest.NewRecorder()
+		r.handleReq(resp, req)
+		if resp.Code != 202 {
+			b.Fatalf("unexpected status %d: %s", resp.Code, resp.Body.String())
+		}
+	}
+}
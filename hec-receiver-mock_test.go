@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestEventUnmarshalJSON_ValidationCodes exercises the HEC error-code
+// mapping in Event.UnmarshalJSON (chunk0-1, tightened by chunk0-5).
+func TestEventUnmarshalJSON_ValidationCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int  // 0 means no *hecEventValidationError expected
+		wantErr  bool // true if any error (including non-validation) is expected
+	}{
+		{name: "missing event field", body: `{"host":"h"}`, wantCode: hecCodeEventFieldRequired},
+		{name: "blank event field", body: `{"event":""}`, wantCode: hecCodeEventFieldBlank},
+		{name: "null event field is accepted as empty", body: `{"event":null}`},
+		{name: "non-string event field", body: `{"event":{"a":1}}`, wantCode: hecCodeInvalidDataFormat},
+		{name: "fields not an object", body: `{"event":"x","fields":"nope"}`, wantCode: hecCodeFieldsMustBeObject},
+		{name: "fields explicitly null", body: `{"event":"x","fields":null}`, wantCode: hecCodeFieldsMustBeObject},
+		{name: "field value is a nested object", body: `{"event":"x","fields":{"a":{"nested":1}}}`, wantCode: hecCodeErrorHandlingIndexed},
+		{name: "field value is an array of objects", body: `{"event":"x","fields":{"a":[{"nested":1}]}}`, wantCode: hecCodeErrorHandlingIndexed},
+		{name: "field value is an array of scalars", body: `{"event":"x","fields":{"a":[1,2,3]}}`},
+		{name: "valid event", body: `{"event":"x","fields":{"a":1}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e Event
+			err := json.Unmarshal([]byte(tt.body), &e)
+			if tt.wantCode == 0 && !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var valErr *hecEventValidationError
+			if !errors.As(err, &valErr) {
+				t.Fatalf("expected *hecEventValidationError, got %v", err)
+			}
+			if valErr.code != tt.wantCode {
+				t.Fatalf("got code %d, want %d", valErr.code, tt.wantCode)
+			}
+		})
+	}
+}
+
+// TestWrapWriteTimeout_RespondsOnTimeout verifies the write-timeout
+// responder (chunk0-3): a handler that doesn't finish before writeTimeout -
+// writeTimeoutMargin gets preempted by a 503 whose JSON body carries
+// hecCodeServerBusy, instead of the client seeing a hung or truncated
+// connection.
+func TestWrapWriteTimeout_RespondsOnTimeout(t *testing.T) {
+	r := &splunkReceiver{}
+	slow := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-req.Context().Done():
+		}
+		resp.WriteHeader(http.StatusOK)
+		resp.Write([]byte("too late"))
+	})
+
+	wrapped := r.wrapWriteTimeout(slow, writeTimeoutMargin+100*time.Millisecond)
+	srv := httptest.NewServer(wrapped)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	var decoded hecResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatalf("decoding timeout body: %v", err)
+	}
+	if decoded.Code != hecCodeServerBusy {
+		t.Fatalf("got code %d, want %d", decoded.Code, hecCodeServerBusy)
+	}
+}
+
+// TestWrapWriteTimeout_PassesThroughFastHandler confirms a handler that
+// responds well within the deadline is untouched by the timeout responder.
+func TestWrapWriteTimeout_PassesThroughFastHandler(t *testing.T) {
+	r := &splunkReceiver{}
+	fast := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusOK)
+		resp.Write([]byte("ok"))
+	})
+
+	wrapped := r.wrapWriteTimeout(fast, writeTimeoutMargin+100*time.Millisecond)
+	srv := httptest.NewServer(wrapped)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+// TestHandleReq_TokenAuthDefaultsAndIndexAllowList covers chunk0-6's token
+// authentication, per-token defaults, and index allow-list enforcement.
+func TestHandleReq_TokenAuthDefaultsAndIndexAllowList(t *testing.T) {
+	store := NewStaticTokenStore([]TokenConfig{
+		{Token: "good-token", DefaultIndex: "prod", AllowedIndexes: []string{"prod"}},
+	})
+	cfg := DefaultConfig()
+	cfg.TokenStore = store
+	r, err := NewLogsReceiver(cfg)
+	if err != nil {
+		t.Fatalf("NewLogsReceiver: %v", err)
+	}
+	handler := r.authenticate(r.handleReq)
+
+	t.Run("missing token is rejected", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/services/collector/event", strings.NewReader(`{"event":"x"}`))
+		resp := httptest.NewRecorder()
+		handler(resp, req)
+		if resp.Code != http.StatusUnauthorized {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusUnauthorized)
+		}
+	})
+
+	t.Run("event missing index gets the token default", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/services/collector/event", strings.NewReader(`{"event":"x"}`))
+		req.Header.Set("Authorization", "Splunk good-token")
+		resp := httptest.NewRecorder()
+		handler(resp, req)
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("got status %d, want %d: %s", resp.Code, http.StatusAccepted, resp.Body.String())
+		}
+	})
+
+	t.Run("event with disallowed index is rejected with code 7", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/services/collector/event", strings.NewReader(`{"event":"x","index":"other"}`))
+		req.Header.Set("Authorization", "Splunk good-token")
+		resp := httptest.NewRecorder()
+		handler(resp, req)
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("got status %d, want %d", resp.Code, http.StatusBadRequest)
+		}
+		var decoded hecResponse
+		if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+			t.Fatalf("decoding body: %v", err)
+		}
+		if decoded.Code != hecCodeIncorrectIndex {
+			t.Fatalf("got code %d, want %d", decoded.Code, hecCodeIncorrectIndex)
+		}
+	})
+}
+
+// TestStatsConsumer_RecordStats_NoPanicOnExactMarkerLength guards against a
+// regression of the event.Event[:9]/[10:] slicing in recordStats: an Event
+// whose value is exactly "---end---" (no trailing count) must not panic.
+func TestStatsConsumer_RecordStats_NoPanicOnExactMarkerLength(t *testing.T) {
+	c := &statsConsumer{}
+	if err := c.recordStats([]*Event{{Source: "s", Event: "---end---"}}); err == nil {
+		t.Fatal("expected a parse error for a marker with no trailing count, got nil")
+	}
+}
+
+// TestCalculateStats_NoInfEpsOnFirstBatch guards against calculateStats
+// dividing by a zero-length time window (beginTime == endTime on a
+// source's first recorded batch), which previously produced +Inf and broke
+// JSON encoding for GET /summary.
+func TestCalculateStats_NoInfEpsOnFirstBatch(t *testing.T) {
+	cfg := DefaultConfig()
+	r, err := NewLogsReceiver(cfg)
+	if err != nil {
+		t.Fatalf("NewLogsReceiver: %v", err)
+	}
+	if err := r.logsConsumer.ConsumeLogs(nil, []*Event{{Source: "s", Event: "x"}}); err != nil {
+		t.Fatalf("ConsumeLogs: %v", err)
+	}
+
+	result := r.calculateStats()
+	if _, err := json.Marshal(result); err != nil {
+		t.Fatalf("marshaling stats: %v", err)
+	}
+	for _, d := range *result {
+		if math.IsInf(d.Eps, 0) {
+			t.Fatalf("got Eps = %v, want a finite value", d.Eps)
+		}
+	}
+}
+
+// fakeConsumer is a LogsConsumer/MetricsConsumer test double that just
+// records the batches it was handed.
+type fakeConsumer struct {
+	mu    sync.Mutex
+	calls [][]*Event
+}
+
+func (f *fakeConsumer) consume(events []*Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, events)
+	return nil
+}
+
+func (f *fakeConsumer) ConsumeLogs(ctx context.Context, events []*Event) error {
+	return f.consume(events)
+}
+
+func (f *fakeConsumer) ConsumeMetrics(ctx context.Context, events []*Event) error {
+	return f.consume(events)
+}
+
+// TestHandleRawReq_QueryParamsAndLines covers chunk0-2's /services/collector/raw
+// path: one event per non-empty line, with host/source/sourcetype/index taken
+// from query parameters rather than per-event JSON fields.
+func TestHandleRawReq_QueryParamsAndLines(t *testing.T) {
+	logs := &fakeConsumer{}
+	r, err := NewLogsReceiver(DefaultConfig(), WithLogsConsumer(logs))
+	if err != nil {
+		t.Fatalf("NewLogsReceiver: %v", err)
+	}
+
+	body := "first line\nsecond line\n\nthird line"
+	req := httptest.NewRequest(http.MethodPost, "/services/collector/raw?host=h&source=s&sourcetype=st&index=idx", strings.NewReader(body))
+	resp := httptest.NewRecorder()
+	r.handleRawReq(resp, req)
+
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("got status %d, want %d: %s", resp.Code, http.StatusAccepted, resp.Body.String())
+	}
+	if len(logs.calls) != 1 {
+		t.Fatalf("got %d ConsumeLogs calls, want 1", len(logs.calls))
+	}
+	events := logs.calls[0]
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3 (blank line skipped)", len(events))
+	}
+	want := []string{"first line", "second line", "third line"}
+	for i, e := range events {
+		if e.Event != want[i] {
+			t.Errorf("event %d: got %q, want %q", i, e.Event, want[i])
+		}
+		if e.Host != "h" || e.Source != "s" || e.SourceType != "st" || e.Index != "idx" {
+			t.Errorf("event %d: got host=%q source=%q sourcetype=%q index=%q, want h/s/st/idx", i, e.Host, e.Source, e.SourceType, e.Index)
+		}
+	}
+}
+
+// TestDecodeBody_RealGzipReader covers chunk0-2's gzip.Reader wiring in
+// decodeBody: a gzip-encoded body with Content-Encoding: gzip decompresses
+// to the original plaintext.
+func TestDecodeBody_RealGzipReader(t *testing.T) {
+	r, err := NewLogsReceiver(DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewLogsReceiver: %v", err)
+	}
+
+	const want = `{"event":"hello"}`
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(want)); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/services/collector/event", bytes.NewReader(buf.Bytes()))
+	req.Header.Set(httpContentEncodingHeader, gzipEncoding)
+	resp := httptest.NewRecorder()
+
+	body, ok := r.decodeBody(resp, req)
+	if !ok {
+		t.Fatalf("decodeBody failed: %s", resp.Body.String())
+	}
+	defer body.Close()
+
+	got, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("reading decoded body: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// TestConsume_RoutesMetricEventsToMetricsConsumer covers chunk0-2's
+// Event=="metric" split in consume: logs and metrics in the same batch are
+// routed to their respective consumers.
+func TestConsume_RoutesMetricEventsToMetricsConsumer(t *testing.T) {
+	logs := &fakeConsumer{}
+	metrics := &fakeConsumer{}
+	r, err := NewLogsReceiver(DefaultConfig(), WithLogsConsumer(logs), WithMetricsConsumer(metrics))
+	if err != nil {
+		t.Fatalf("NewLogsReceiver: %v", err)
+	}
+
+	events := []*Event{
+		{Source: "s1", Event: "a plain log line"},
+		{Source: "s2", Event: "metric"},
+	}
+	resp := httptest.NewRecorder()
+	r.consume(context.Background(), events, resp, "")
+
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("got status %d, want %d: %s", resp.Code, http.StatusAccepted, resp.Body.String())
+	}
+	if len(logs.calls) != 1 || len(logs.calls[0]) != 1 || logs.calls[0][0].Source != "s1" {
+		t.Fatalf("got logs calls %+v, want exactly one batch with event s1", logs.calls)
+	}
+	if len(metrics.calls) != 1 || len(metrics.calls[0]) != 1 || metrics.calls[0][0].Source != "s2" {
+		t.Fatalf("got metrics calls %+v, want exactly one batch with event s2", metrics.calls)
+	}
+}
+
+// TestHandleReq_RateLimit covers chunk0-6's per-token/per-channel token-
+// bucket rate limiting.
+func TestHandleReq_RateLimit(t *testing.T) {
+	store := NewStaticTokenStore([]TokenConfig{
+		{Token: "limited-token", DefaultIndex: "prod", RateLimitEPS: 1},
+	})
+	cfg := DefaultConfig()
+	cfg.TokenStore = store
+	r, err := NewLogsReceiver(cfg)
+	if err != nil {
+		t.Fatalf("NewLogsReceiver: %v", err)
+	}
+	handler := r.authenticate(r.handleReq)
+
+	newReq := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/services/collector/event", strings.NewReader(`{"event":"x"}`))
+		req.Header.Set("Authorization", "Splunk limited-token")
+		return req
+	}
+
+	resp := httptest.NewRecorder()
+	handler(resp, newReq())
+	if resp.Code != http.StatusAccepted {
+		t.Fatalf("first request got status %d, want %d: %s", resp.Code, http.StatusAccepted, resp.Body.String())
+	}
+
+	resp = httptest.NewRecorder()
+	handler(resp, newReq())
+	if resp.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request got status %d, want %d: %s", resp.Code, http.StatusTooManyRequests, resp.Body.String())
+	}
+	var decoded hecResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatalf("decoding body: %v", err)
+	}
+	if decoded.Code != hecCodeServerBusy {
+		t.Fatalf("got code %d, want %d", decoded.Code, hecCodeServerBusy)
+	}
+}